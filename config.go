@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type keyword struct {
+	Type       string   `json:"type"`
+	Keyword    string   `json:"keyword"`
+	Pattern    string   `json:"pattern"`
+	Flags      string   `json:"flags"`
+	Severity   string   `json:"severity"`
+	MaxMatches int      `json:"max_matches"`
+	Exceptions []string `json:"exceptions"`
+}
+
+type configuration struct {
+	Timeout         string           `json:"timeout"`
+	ShutdownTimeout string           `json:"shutdown_timeout"`
+	Mailonerror     bool             `json:"mail_on_error"`
+	Keywords        []keyword        `json:"keywords"`
+	Sources         []SourceConfig   `json:"sources"`
+	Notifiers       []NotifierConfig `json:"notifiers"`
+	Store           StoreConfig      `json:"store"`
+	MetricsAddr     string           `json:"metrics_addr"`
+
+	SMTPHost string `json:"smtp_host"`
+	SMTPPort int    `json:"smtp_port"`
+	MailTo   string `json:"mail_to"`
+	MailFrom string `json:"mail_from"`
+}
+
+// NotifierConfig describes one configured Notifier sink in the config file.
+type NotifierConfig struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	MinSeverity string `json:"min_severity"`
+	URL         string `json:"url"`
+	Channel     string `json:"channel"`
+	Token       string `json:"token"`
+	Index       string `json:"index"`
+	Source      string `json:"source"`
+}
+
+func getConfig(path string) (*configuration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open config file: %v", err)
+	}
+	defer f.Close()
+
+	var c configuration
+	if err := json.NewDecoder(f).Decode(&c); err != nil {
+		return nil, fmt.Errorf("could not decode config file: %v", err)
+	}
+	return &c, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var client = &http.Client{}
+
+// rateLimitError is returned when a source's HTTP response indicates we're
+// being throttled or blocked, so the scheduler can back off instead of
+// treating it like an ordinary fetch error.
+type rateLimitError struct {
+	status int
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("rate limited (status %d)", e.status)
+}
+
+// checkRateLimited inspects a response for the usual throttling signals:
+// a 429/403 status, or Pastebin's "you've been banned" text.
+func checkRateLimited(resp *http.Response, body []byte) error {
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden {
+		return &rateLimitError{status: resp.StatusCode}
+	}
+	if strings.Contains(strings.ToLower(string(body)), "you've been banned") {
+		return &rateLimitError{status: resp.StatusCode}
+	}
+	return nil
+}
+
+// postJSON marshals payload and POSTs it to url with a JSON content type.
+func postJSON(ctx context.Context, url string, payload interface{}) error {
+	return postJSONWithHeaders(ctx, url, payload, nil)
+}
+
+// postJSONWithHeaders is postJSON with additional request headers, used by
+// sinks that authenticate via a header (e.g. Splunk HEC tokens).
+func postJSONWithHeaders(ctx context.Context, url string, payload interface{}, headers map[string]string) error {
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, url)
+	}
+	return nil
+}
+
+// fetchText performs a GET against url and returns the response body as a
+// string. It is shared by every PasteSource that scrapes a plain-text or
+// HTML endpoint rather than a JSON API.
+func fetchText(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkRateLimited(resp, body); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s for %s", resp.Status, url)
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestIPv6AddrCompiles(t *testing.T) {
+	if _, err := regexp.Compile(ipv6Addr); err != nil {
+		t.Fatalf("ipv6Addr failed to compile: %v", err)
+	}
+}
+
+// TestIPv6AddrExtraction exercises the alternatives of ipv6Addr directly,
+// independent of CIDR containment, since Go's leftmost-first alternation
+// previously let an earlier, shorter alternative win and truncate these
+// exact notations mid-match.
+func TestIPv6AddrExtraction(t *testing.T) {
+	re := regexp.MustCompile(`(` + ipv6Addr + `)`)
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"full notation", "seen 2001:0db8:0000:0000:0000:0000:0000:0001 here", "2001:0db8:0000:0000:0000:0000:0000:0001"},
+		{"compressed notation", "seen 2001:db8::1 here", "2001:db8::1"},
+		{"v4-mapped notation", "seen ::ffff:192.168.1.1 here", "::ffff:192.168.1.1"},
+		{"loopback", "seen ::1 here", "::1"},
+		{"unspecified", "seen :: here", "::"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := re.FindString(tc.body); got != tc.want {
+				t.Fatalf("matched %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseKeywordsCIDRv6(t *testing.T) {
+	tests := []struct {
+		name string
+		cidr string
+		body string
+		want string
+	}{
+		{
+			name: "full notation",
+			cidr: "2001:db8::/32",
+			body: "seen 2001:0db8:0000:0000:0000:0000:0000:0001 here",
+			want: "2001:0db8:0000:0000:0000:0000:0000:0001",
+		},
+		{
+			name: "compressed notation",
+			cidr: "2001:db8::/32",
+			body: "seen 2001:db8::1 here",
+			want: "2001:db8::1",
+		},
+		{
+			name: "zone id stripped before parsing",
+			cidr: "fe80::/10",
+			body: "seen fe80::1%eth0 here",
+			want: "fe80::1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			keywords, err := parseKeywords([]keyword{{Type: "cidr", Keyword: tc.cidr}})
+			if err != nil {
+				t.Fatalf("parseKeywords: %v", err)
+			}
+
+			result := checkKeywords(tc.body, keywords)
+			if !result.Matched {
+				t.Fatalf("expected %q to match cidr %s in %q", tc.want, tc.cidr, tc.body)
+			}
+
+			m := result.Keywords[tc.cidr]
+			if len(m.Matches) != 1 {
+				t.Fatalf("expected 1 match, got %d: %+v", len(m.Matches), m.Matches)
+			}
+			if got := m.Matches[0].Value; got != tc.want {
+				t.Fatalf("matched %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestParseKeywordsRegexMultiMatch(t *testing.T) {
+	body := "line one: id=42\nline two: id=99\nline three: no match here"
+	keywords, err := parseKeywords([]keyword{{
+		Type:    "regex",
+		Keyword: "ids",
+		Pattern: `id=(?P<id>\d+)`,
+	}})
+	if err != nil {
+		t.Fatalf("parseKeywords: %v", err)
+	}
+
+	result := checkKeywords(body, keywords)
+	if !result.Matched {
+		t.Fatal("expected a match")
+	}
+
+	m := result.Keywords["ids"]
+	if len(m.Matches) != 2 {
+		t.Fatalf("expected 2 matches, got %d: %+v", len(m.Matches), m.Matches)
+	}
+	if m.Matches[0].Line != 1 || m.Matches[0].Value != "42" || m.Matches[0].Groups["id"] != "42" {
+		t.Fatalf("unexpected first match: %+v", m.Matches[0])
+	}
+	if m.Matches[1].Line != 2 || m.Matches[1].Value != "99" || m.Matches[1].Groups["id"] != "99" {
+		t.Fatalf("unexpected second match: %+v", m.Matches[1])
+	}
+}
+
+func TestParseKeywordsInvalidRegex(t *testing.T) {
+	if _, err := parseKeywords([]keyword{{Type: "regex", Keyword: "bad", Pattern: `(unclosed`}}); err == nil {
+		t.Fatal("expected an error for an invalid regex pattern")
+	}
+}
+
+func TestParseKeywordsInvalidSeverity(t *testing.T) {
+	_, err := parseKeywords([]keyword{{Type: "regex", Keyword: "k", Pattern: "x", Severity: "Critical"}})
+	if err == nil {
+		t.Fatal("expected an error for an unrecognized severity")
+	}
+}
+
+func TestBuildNotifiersInvalidSeverity(t *testing.T) {
+	cfg := configuration{Notifiers: []NotifierConfig{{Type: "smtp", MinSeverity: "urgent"}}}
+	if _, err := buildNotifiers(cfg); err == nil {
+		t.Fatal("expected an error for an unrecognized min_severity")
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"net/smtp"
+)
+
+func sendErrorMessage(c configuration, err error) error {
+	return sendMail(c, "Pastebin Scraper Error", err.Error())
+}
+
+func sendMail(c configuration, subject, body string) error {
+	if *test {
+		debugOutput("%s: %s", subject, body)
+		return nil
+	}
+	msg := []byte(fmt.Sprintf("Subject: %s\r\n\r\n%s\r\n", subject, body))
+	addr := fmt.Sprintf("%s:%d", c.SMTPHost, c.SMTPPort)
+	return smtp.SendMail(addr, nil, c.MailFrom, []string{c.MailTo}, msg)
+}
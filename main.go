@@ -2,28 +2,84 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
+	"os"
+	"os/signal"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+
+	"golang.org/x/time/rate"
 )
 
 var (
 	debug = flag.Bool("debug", false, "Print debug output")
 	test  = flag.Bool("test", false, "do not send mails, print them instead")
 
-	r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	// r is shared by every source's backoff jitter, so access must go
+	// through rMu: *rand.Rand is not safe for concurrent use and each
+	// source backs off from its own pollSource goroutine.
+	r   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	rMu sync.Mutex
 )
 
+// ipv6Addr matches full, compressed (::) and mixed (v4-mapped) IPv6
+// notation. No alternative matches a zone ID, so in "fe80::1%eth0" the
+// match stops before the "%".
+// Adapted from https://www.regular-expressions.info/ip.html, but reordered
+// most-specific-first: Go's regexp package matches leftmost-first rather
+// than leftmost-longest, so an earlier, less specific alternative (e.g.
+// the bare "X::" compressed form) can otherwise win over a later one that
+// would have matched more of the address, truncating it.
+const ipv6Addr = `(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}` +
+	`|(?:[0-9A-Fa-f]{1,4}:){1,4}:(?:(?:25[0-5]|(?:2[0-4]|1?[0-9])?[0-9])\.){3}(?:25[0-5]|(?:2[0-4]|1?[0-9])?[0-9])` +
+	`|::(?:ffff(?::0{1,4})?:)?(?:(?:25[0-5]|(?:2[0-4]|1?[0-9])?[0-9])\.){3}(?:25[0-5]|(?:2[0-4]|1?[0-9])?[0-9])` +
+	`|[0-9A-Fa-f]{1,4}:(?:(?::[0-9A-Fa-f]{1,4}){1,6})` +
+	`|(?:[0-9A-Fa-f]{1,4}:){1,2}(?::[0-9A-Fa-f]{1,4}){1,5}` +
+	`|(?:[0-9A-Fa-f]{1,4}:){1,3}(?::[0-9A-Fa-f]{1,4}){1,4}` +
+	`|(?:[0-9A-Fa-f]{1,4}:){1,4}(?::[0-9A-Fa-f]{1,4}){1,3}` +
+	`|(?:[0-9A-Fa-f]{1,4}:){1,5}(?::[0-9A-Fa-f]{1,4}){1,2}` +
+	`|(?:[0-9A-Fa-f]{1,4}:){1,6}:[0-9A-Fa-f]{1,4}` +
+	`|(?:[0-9A-Fa-f]{1,4}:){1,7}:` +
+	`|:(?:(?::[0-9A-Fa-f]{1,4}){1,7}|:)`
+
 type keywordType struct {
 	regexp      *regexp.Regexp
 	keywordType string
 	ipNet       *net.IPNet
 	exceptions  []string
+	severity    string
+	maxMatches  int
+}
+
+// matchOccurrence is a single match of a keyword within a paste body,
+// including the line it was found on and any named capture groups so
+// notification templates can surface context around the hit.
+type matchOccurrence struct {
+	Value  string
+	Line   int
+	Groups map[string]string
+}
+
+type keywordMatch struct {
+	Severity string
+	Matches  []matchOccurrence
+}
+
+// checkResult is the outcome of running a paste body against the
+// configured keywords: whether anything matched, and every occurrence of
+// every keyword that did (not just the first).
+type checkResult struct {
+	Matched  bool
+	Keywords map[string]keywordMatch
 }
 
 func debugOutput(s string, a ...interface{}) {
@@ -32,36 +88,82 @@ func debugOutput(s string, a ...interface{}) {
 	}
 }
 
-func checkKeywords(body string, keywords *map[string]keywordType) (bool, map[string]string) {
-	found := make(map[string]string)
-	status := false
+func checkKeywords(body string, keywords *map[string]keywordType) checkResult {
+	result := checkResult{Keywords: make(map[string]keywordMatch)}
 	for k, v := range *keywords {
-		if v.regexp != nil {
-			if s := v.regexp.FindStringSubmatch(body); s != nil {
-				match := strings.TrimSpace(s[1])
-				switch v.keywordType {
-				case "ip":
-					ip := net.ParseIP(match)
-					// invalid IP matched
-					if ip == nil {
-						debugOutput("%q is not a valid ip", match)
-						continue
-					}
-					if v.ipNet.Contains(ip) {
-						debugOutput("%v contains %s", v.ipNet, ip)
-						found[k] = match
-						status = true
-					}
-				default:
-					if !checkExceptions(match, v.exceptions) {
-						found[k] = match
-						status = true
-					}
+		if v.regexp == nil {
+			continue
+		}
+
+		limit := v.maxMatches
+		if limit <= 0 {
+			limit = -1
+		}
+
+		var occurrences []matchOccurrence
+		for _, idx := range v.regexp.FindAllSubmatchIndex([]byte(body), limit) {
+			start, end := idx[0], idx[1]
+			if len(idx) >= 4 && idx[2] >= 0 {
+				start, end = idx[2], idx[3]
+			}
+			match := strings.TrimSpace(body[start:end])
+
+			switch v.keywordType {
+			case "ip":
+				// strip a zone ID (e.g. "fe80::1%eth0") before parsing
+				addr := match
+				if zone := strings.IndexByte(addr, '%'); zone != -1 {
+					addr = addr[:zone]
+				}
+				ip := net.ParseIP(addr)
+				// invalid IP matched
+				if ip == nil {
+					debugOutput("%q is not a valid ip", match)
+					continue
+				}
+				if !v.ipNet.Contains(ip) {
+					continue
+				}
+				debugOutput("%v contains %s", v.ipNet, ip)
+			default:
+				if checkExceptions(match, v.exceptions) {
+					continue
 				}
 			}
+
+			occurrences = append(occurrences, matchOccurrence{
+				Value:  match,
+				Line:   1 + strings.Count(body[:start], "\n"),
+				Groups: namedGroups(v.regexp, body, idx),
+			})
+		}
+
+		if len(occurrences) == 0 {
+			continue
 		}
+		result.Matched = true
+		result.Keywords[k] = keywordMatch{Severity: v.severity, Matches: occurrences}
 	}
-	return status, found
+	return result
+}
+
+// namedGroups extracts the named capture groups of a single regexp match
+// (as produced by FindAllSubmatchIndex) so they can be exposed to
+// notification templates. It returns nil if the pattern has no named
+// groups.
+func namedGroups(re *regexp.Regexp, body string, idx []int) map[string]string {
+	names := re.SubexpNames()
+	var groups map[string]string
+	for i, name := range names {
+		if name == "" || 2*i+1 >= len(idx) || idx[2*i] < 0 {
+			continue
+		}
+		if groups == nil {
+			groups = make(map[string]string)
+		}
+		groups[name] = body[idx[2*i]:idx[2*i+1]]
+	}
+	return groups
 }
 
 func checkExceptions(s string, exceptions []string) bool {
@@ -78,20 +180,48 @@ func parseKeywords(k []keyword) (*map[string]keywordType, error) {
 	keywords := make(map[string]keywordType)
 	// use a boundary for keyword searching
 	for _, k := range k {
+		severity := severityOr(k.Severity, "warn")
+		if !validSeverity(severity) {
+			return nil, fmt.Errorf("keyword %s: invalid severity %q", k.Keyword, k.Severity)
+		}
 		switch k.Type {
 		case "cidr":
-			// capture IPs (only v4)
-			// https://www.regular-expressions.info/ip.html
-			r := `(\b(?:\d{1,3}\.){3}\d{1,3}\b)`
 			_, n, err := net.ParseCIDR(k.Keyword)
 			if err != nil {
 				return nil, fmt.Errorf("could not parse cidr %s: %v", k.Keyword, err)
 			}
+
+			// detect the address family and compile the matching extractor
+			var re *regexp.Regexp
+			if n.IP.To4() == nil {
+				re = regexp.MustCompile(`(` + ipv6Addr + `)`)
+			} else {
+				re = regexp.MustCompile(`(\b(?:\d{1,3}\.){3}\d{1,3}\b)`)
+			}
+
 			keywords[k.Keyword] = keywordType{
-				regexp:      regexp.MustCompile(r),
+				regexp:      re,
 				keywordType: "ip",
 				ipNet:       n,
 				exceptions:  k.Exceptions,
+				severity:    severity,
+				maxMatches:  k.MaxMatches,
+			}
+		case "regex":
+			pattern := k.Pattern
+			if k.Flags != "" {
+				pattern = fmt.Sprintf("(?%s)%s", k.Flags, pattern)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("could not compile regex %s: %v", k.Keyword, err)
+			}
+			keywords[k.Keyword] = keywordType{
+				regexp:      re,
+				keywordType: "regex",
+				exceptions:  k.Exceptions,
+				severity:    severity,
+				maxMatches:  k.MaxMatches,
 			}
 		default:
 			r := fmt.Sprintf(`(?im)^(.*\b%s.*)$`, regexp.QuoteMeta(k.Keyword))
@@ -99,24 +229,162 @@ func parseKeywords(k []keyword) (*map[string]keywordType, error) {
 				regexp:      regexp.MustCompile(r),
 				keywordType: "string",
 				exceptions:  k.Exceptions,
+				severity:    severity,
+				maxMatches:  k.MaxMatches,
 			}
 		}
 	}
 	return &keywords, nil
 }
 
+func severityOr(s, fallback string) string {
+	if s != "" {
+		return s
+	}
+	return fallback
+}
+
+// keywordStore holds the compiled keyword map and lets SIGHUP swap it for
+// a freshly reloaded one atomically, without disturbing sources that are
+// mid-poll.
+type keywordStore struct {
+	v atomic.Value
+}
+
+func newKeywordStore(k *map[string]keywordType) *keywordStore {
+	ks := &keywordStore{}
+	ks.v.Store(k)
+	return ks
+}
+
+func (ks *keywordStore) Get() *map[string]keywordType {
+	return ks.v.Load().(*map[string]keywordType)
+}
+
+func (ks *keywordStore) Set(k *map[string]keywordType) {
+	ks.v.Store(k)
+}
+
+// maxBackoff caps how long a rate-limited source waits between retries.
+const maxBackoff = 5 * time.Minute
+
+// backoffState tracks a source's exponential backoff across polls so a
+// sustained ban only surfaces one aggregated error instead of spamming
+// chanError on every poll.
+type backoffState struct {
+	current   time.Duration
+	triggered bool
+}
+
+func (b *backoffState) hit(ctx context.Context, name string, chanError chan<- error, metrics *schedulerMetrics) {
+	if b.current == 0 {
+		b.current = 1 * time.Second
+	}
+	if !b.triggered {
+		chanError <- fmt.Errorf("%s: rate limited, backing off", name)
+		b.triggered = true
+	}
+	metrics.setBackoff(name, b.current)
+
+	// jitter avoids a thundering herd when multiple scraper instances
+	// share an IP and get banned at the same time
+	rMu.Lock()
+	jitter := time.Duration(r.Int63n(int64(b.current)/2 + 1))
+	rMu.Unlock()
+	select {
+	case <-ctx.Done():
+	case <-time.After(b.current + jitter):
+	}
+
+	b.current *= 2
+	if b.current > maxBackoff {
+		b.current = maxBackoff
+	}
+}
+
+func (b *backoffState) reset(name string, metrics *schedulerMetrics) {
+	if b.triggered {
+		metrics.setBackoff(name, 0)
+	}
+	b.current = 0
+	b.triggered = false
+}
+
+func isRateLimited(err error) bool {
+	var rle *rateLimitError
+	return errors.As(err, &rle)
+}
+
+// pollSource repeatedly lists and fetches items from a single PasteSource
+// at its own poll interval and rate limit, merging anything that matches
+// keywords into chanOutput. Each source runs independently so a slow or
+// rate-limited provider never holds up the others.
+func pollSource(ctx context.Context, src PasteSource, keywords *keywordStore, seen SeenStore, chanOutput chan<- paste, chanError chan<- error, metrics *schedulerMetrics) {
+	metrics.setRateLimit(src.Name(), float64(src.Limiter().Limit()))
+	backoff := &backoffState{}
+
+	poll := func() {
+		items, err := src.List(ctx)
+		if err != nil {
+			if isRateLimited(err) {
+				backoff.hit(ctx, src.Name(), chanError, metrics)
+				return
+			}
+			chanError <- fmt.Errorf("%s: List: %v", src.Name(), err)
+			return
+		}
+		backoff.reset(src.Name(), metrics)
+
+		for _, item := range items {
+			alreadyChecked, err := seen.CheckAndSet(item.Key)
+			if err != nil {
+				chanError <- fmt.Errorf("%s: seen store: %v", src.Name(), err)
+				continue
+			}
+
+			if alreadyChecked {
+				debugOutput("%s: skipping key %s as it was already checked", src.Name(), item.Key)
+				continue
+			}
+
+			p2, err := src.Fetch(ctx, item, keywords.Get())
+			if err != nil {
+				if isRateLimited(err) {
+					backoff.hit(ctx, src.Name(), chanError, metrics)
+					return
+				}
+				chanError <- fmt.Errorf("%s: Fetch: %v", src.Name(), err)
+			} else if p2 != nil {
+				chanOutput <- *p2
+			}
+
+			// respect the source's configured rate limit instead of a
+			// fixed sleep
+			if err := src.Limiter().Wait(ctx); err != nil {
+				return
+			}
+		}
+	}
+
+	poll()
+	ticker := time.NewTicker(src.PollInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			poll()
+		}
+	}
+}
+
 // nolint: gocyclo
 func main() {
 	configFile := flag.String("config", "", "Config File to use")
-	var lastCheck time.Time
 
 	chanError := make(chan error)
 	chanOutput := make(chan paste)
-	// we run in an endless loop so no need for a waitgroup here
-	defer close(chanOutput)
-	defer close(chanError)
-
-	alredyChecked := make(map[string]time.Time)
 
 	flag.Parse()
 
@@ -126,30 +394,113 @@ func main() {
 		log.Fatalf("could not read config file %s: %v", *configFile, err)
 	}
 
-	keywords, err := parseKeywords(config.Keywords)
+	compiledKeywords, err := parseKeywords(config.Keywords)
 	if err != nil {
 		log.Fatalf("could not parse keywords: %v", err)
 	}
+	keywords := newKeywordStore(compiledKeywords)
+
 	timeout, err := time.ParseDuration(config.Timeout)
 	if err != nil {
 		log.Fatalf("invalid value for timeout: %q - %v", config.Timeout, err)
 	}
 	client.Timeout = timeout
 
+	shutdownTimeout := 30 * time.Second
+	if config.ShutdownTimeout != "" {
+		shutdownTimeout, err = time.ParseDuration(config.ShutdownTimeout)
+		if err != nil {
+			log.Fatalf("invalid value for shutdown_timeout: %q - %v", config.ShutdownTimeout, err)
+		}
+	}
+
+	sources, err := buildSources(config.Sources)
+	if err != nil {
+		log.Fatalf("could not set up paste sources: %v", err)
+	}
+	if len(sources) == 0 {
+		// keep working for configs predating the sources option
+		sources = []PasteSource{&pastebinSource{sourceBase: sourceBase{
+			name:     "pastebin",
+			interval: 1 * time.Minute,
+			limiter:  rate.NewLimiter(rate.Limit(1), 1),
+		}}}
+	}
+
+	notifiers, err := buildNotifiers(*config)
+	if err != nil {
+		log.Fatalf("could not set up notifiers: %v", err)
+	}
+
+	seen, err := buildSeenStore(config.Store)
+	if err != nil {
+		log.Fatalf("could not set up seen store: %v", err)
+	}
+	defer seen.Close()
+
+	metrics := newSchedulerMetrics(seen)
+	serveMetrics(config.MetricsAddr, metrics)
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	go func(c configuration) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	go func() {
+		for sig := range sigCh {
+			if sig == syscall.SIGHUP {
+				log.Println("received SIGHUP, reloading config and keywords")
+				newConfig, err := getConfig(*configFile)
+				if err != nil {
+					log.Printf("reload failed: could not read config: %v", err)
+					continue
+				}
+				newKeywords, err := parseKeywords(newConfig.Keywords)
+				if err != nil {
+					log.Printf("reload failed: could not parse keywords: %v", err)
+					continue
+				}
+				keywords.Set(newKeywords)
+				log.Println("reloaded config and keywords")
+				continue
+			}
+
+			log.Printf("received %v, shutting down", sig)
+			cancel()
+			return
+		}
+	}()
+
+	// consumerWG tracks the chanOutput/chanError consumers so shutdown can
+	// wait for in-flight notification dispatch (including retries) to
+	// drain instead of killing it mid-flight.
+	var consumerWG sync.WaitGroup
+
+	// dispatch runs under its own context, since ctx is cancelled as soon
+	// as a shutdown signal arrives; it is cancelled only when main returns.
+	notifyCtx, notifyCancel := context.WithCancel(context.Background())
+	defer notifyCancel()
+
+	consumerWG.Add(1)
+	go func() {
+		defer consumerWG.Done()
 		for p := range chanOutput {
 			debugOutput("found paste:\n%s", p)
-			err = p.sendPasteMessage(c)
-			if err != nil {
-				chanError <- fmt.Errorf("sendPasteMessage: %v", err)
+			event := PasteEvent{
+				Paste:    p,
+				Keywords: p.Matches,
+				Severity: highestSeverity(p.Matches),
+				Excerpt:  excerptFor(p, p.Matches),
 			}
+			dispatchEvent(notifyCtx, notifiers, event)
 		}
-	}(*config)
+	}()
 
+	consumerWG.Add(1)
 	go func(c configuration) {
+		defer consumerWG.Done()
 		for err := range chanError {
 			log.Printf("%v", err)
 			if c.Mailonerror {
@@ -161,44 +512,35 @@ func main() {
 		}
 	}(*config)
 
-	for {
-		// Only fetch the main list once a minute
-		sleepTime := time.Until(lastCheck.Add(1 * time.Minute))
-		if sleepTime > 0 {
-			debugOutput("sleeping for %s", sleepTime)
-			time.Sleep(sleepTime)
-		}
+	var sourceWG sync.WaitGroup
+	for _, src := range sources {
+		sourceWG.Add(1)
+		go func(src PasteSource) {
+			defer sourceWG.Done()
+			pollSource(ctx, src, keywords, seen, chanOutput, chanError, metrics)
+		}(src)
+	}
 
-		lastCheck = time.Now()
-		pastes, err := fetchPasteList(ctx)
-		if err != nil {
-			chanError <- fmt.Errorf("fetchPasteList: %v", err)
-			continue
-		}
+	<-ctx.Done()
+	log.Println("draining in-flight fetches and notifications")
 
-		for _, p := range pastes {
-			if _, ok := alredyChecked[p.Key]; ok {
-				debugOutput("skipping key %s as it was already checked", p.Key)
-			} else {
-				alredyChecked[p.Key] = time.Now()
-				p2, err := p.fetch(ctx, keywords)
-				if err != nil {
-					chanError <- fmt.Errorf("fetch: %v", err)
-				} else if p2 != nil {
-					chanOutput <- *p2
-				}
-				// do not hammer the API
-				time.Sleep(1 * time.Second)
-			}
-		}
-		// clean up old items in alreadyChecked map
-		// delete everything older than 10 minutes
-		threshold := time.Now().Add(-10 * time.Minute)
-		for k, v := range alredyChecked {
-			if v.Before(threshold) {
-				debugOutput("deleting expired entry %s", k)
-				delete(alredyChecked, k)
-			}
-		}
+	drained := make(chan struct{})
+	go func() {
+		// sources must stop sending before the channels can be closed,
+		// and the channels must close before the consumers' range loops
+		// (and therefore any in-flight notification retries) can finish.
+		sourceWG.Wait()
+		close(chanOutput)
+		close(chanError)
+		consumerWG.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		log.Println("shutdown complete")
+	case <-time.After(shutdownTimeout):
+		log.Printf("shutdown timeout of %s exceeded, abandoning in-flight work", shutdownTimeout)
 	}
+	// the standard logger writes unbuffered, so there is nothing left to flush
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// schedulerMetrics tracks each source's configured rate limit and current
+// backoff, plus the seen store's hit/miss/size counters, so they can be
+// inspected on an optional /metrics endpoint, similar in spirit to a
+// Prometheus exporter.
+type schedulerMetrics struct {
+	mu    sync.Mutex
+	state map[string]sourceMetrics
+	store SeenStore
+}
+
+type sourceMetrics struct {
+	rateLimit float64
+	backoff   time.Duration
+}
+
+func newSchedulerMetrics(store SeenStore) *schedulerMetrics {
+	return &schedulerMetrics{state: make(map[string]sourceMetrics), store: store}
+}
+
+func (m *schedulerMetrics) setRateLimit(source string, rps float64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.state[source]
+	s.rateLimit = rps
+	m.state[source] = s
+}
+
+func (m *schedulerMetrics) setBackoff(source string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.state[source]
+	s.backoff = d
+	m.state[source] = s
+}
+
+func (m *schedulerMetrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP pastebin_scraper_source_rate_limit Configured rate limit in requests per second.")
+	fmt.Fprintln(w, "# TYPE pastebin_scraper_source_rate_limit gauge")
+	for name, s := range m.state {
+		fmt.Fprintf(w, "pastebin_scraper_source_rate_limit{source=%q} %g\n", name, s.rateLimit)
+	}
+
+	fmt.Fprintln(w, "# HELP pastebin_scraper_source_backoff_seconds Current backoff duration in seconds.")
+	fmt.Fprintln(w, "# TYPE pastebin_scraper_source_backoff_seconds gauge")
+	for name, s := range m.state {
+		fmt.Fprintf(w, "pastebin_scraper_source_backoff_seconds{source=%q} %g\n", name, s.backoff.Seconds())
+	}
+
+	if m.store == nil {
+		return
+	}
+	stats := m.store.Stats()
+
+	fmt.Fprintln(w, "# HELP pastebin_scraper_seen_store_hits_total Seen store lookups for a key already recorded.")
+	fmt.Fprintln(w, "# TYPE pastebin_scraper_seen_store_hits_total counter")
+	fmt.Fprintf(w, "pastebin_scraper_seen_store_hits_total %d\n", stats.Hits)
+
+	fmt.Fprintln(w, "# HELP pastebin_scraper_seen_store_misses_total Seen store lookups for a new key.")
+	fmt.Fprintln(w, "# TYPE pastebin_scraper_seen_store_misses_total counter")
+	fmt.Fprintf(w, "pastebin_scraper_seen_store_misses_total %d\n", stats.Misses)
+
+	fmt.Fprintln(w, "# HELP pastebin_scraper_seen_store_size Entries currently tracked by the seen store.")
+	fmt.Fprintln(w, "# TYPE pastebin_scraper_seen_store_size gauge")
+	fmt.Fprintf(w, "pastebin_scraper_seen_store_size %d\n", stats.Size)
+}
+
+// serveMetrics starts an HTTP server exposing m on /metrics if addr is
+// configured. It is a no-op otherwise.
+func serveMetrics(addr string, m *schedulerMetrics) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("metrics server stopped: %v", err)
+		}
+	}()
+}
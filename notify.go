@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// PasteEvent is the structured payload handed to every configured Notifier
+// when a paste matches one or more keywords, so sinks render their own
+// message instead of receiving a pre-rendered email body.
+type PasteEvent struct {
+	Paste    paste
+	Keywords map[string]keywordMatch
+	Severity string
+	Excerpt  string
+}
+
+// Notifier delivers a PasteEvent to a single sink (SMTP, a webhook, Slack,
+// Matrix, Splunk HEC, ...). Implementations must be safe for concurrent use
+// since the dispatcher fans a single event out to every sink in parallel.
+type Notifier interface {
+	Name() string
+	MinSeverity() string
+	Notify(ctx context.Context, event PasteEvent) error
+}
+
+var severityRank = map[string]int{"info": 0, "warn": 1, "critical": 2}
+
+// validSeverity reports whether s is one of the recognized severity
+// levels. Used to reject typos and unrecognized values at parse time
+// instead of letting them silently rank as "info".
+func validSeverity(s string) bool {
+	_, ok := severityRank[s]
+	return ok
+}
+
+func severityAtLeast(severity, min string) bool {
+	if min == "" {
+		return true
+	}
+	return severityRank[severity] >= severityRank[min]
+}
+
+// highestSeverity returns the most severe severity across every keyword
+// that matched, so a single event can be filtered against a sink's
+// MinSeverity.
+func highestSeverity(matches map[string]keywordMatch) string {
+	best := "info"
+	for _, m := range matches {
+		if severityRank[m.Severity] > severityRank[best] {
+			best = m.Severity
+		}
+	}
+	return best
+}
+
+// excerptFor returns a short snippet to show in notifications: the first
+// matched value if there is one, otherwise the start of the paste body.
+func excerptFor(p paste, matches map[string]keywordMatch) string {
+	for _, m := range matches {
+		if len(m.Matches) > 0 {
+			return m.Matches[0].Value
+		}
+	}
+	if len(p.Body) > 200 {
+		return p.Body[:200]
+	}
+	return p.Body
+}
+
+// buildNotifiers turns the configured notifier list into live Notifiers.
+func buildNotifiers(cfg configuration) ([]Notifier, error) {
+	notifiers := make([]Notifier, 0, len(cfg.Notifiers))
+	for _, c := range cfg.Notifiers {
+		minSeverity := severityOr(c.MinSeverity, "info")
+		if !validSeverity(minSeverity) {
+			return nil, fmt.Errorf("notifier %s: invalid min_severity %q", c.Name, c.MinSeverity)
+		}
+		switch c.Type {
+		case "smtp", "":
+			notifiers = append(notifiers, &smtpNotifier{name: nameOr(c.Name, "smtp"), minSeverity: minSeverity, cfg: cfg})
+		case "webhook":
+			if c.URL == "" {
+				return nil, fmt.Errorf("notifier %s: webhook requires a url", c.Name)
+			}
+			notifiers = append(notifiers, &webhookNotifier{name: nameOr(c.Name, "webhook"), minSeverity: minSeverity, url: c.URL})
+		case "slack":
+			if c.URL == "" {
+				return nil, fmt.Errorf("notifier %s: slack requires a url", c.Name)
+			}
+			notifiers = append(notifiers, &slackNotifier{name: nameOr(c.Name, "slack"), minSeverity: minSeverity, url: c.URL})
+		case "matrix":
+			if c.URL == "" || c.Channel == "" || c.Token == "" {
+				return nil, fmt.Errorf("notifier %s: matrix requires url, channel and token", c.Name)
+			}
+			notifiers = append(notifiers, &matrixNotifier{name: nameOr(c.Name, "matrix"), minSeverity: minSeverity, homeserver: c.URL, room: c.Channel, token: c.Token})
+		case "splunk":
+			if c.URL == "" || c.Token == "" {
+				return nil, fmt.Errorf("notifier %s: splunk requires url and token", c.Name)
+			}
+			notifiers = append(notifiers, &splunkNotifier{name: nameOr(c.Name, "splunk"), minSeverity: minSeverity, url: c.URL, token: c.Token, index: c.Index, source: c.Source})
+		default:
+			return nil, fmt.Errorf("notifier %s: unknown type %q", c.Name, c.Type)
+		}
+	}
+	if len(notifiers) == 0 {
+		// keep working for configs predating the notifiers option
+		notifiers = append(notifiers, &smtpNotifier{name: "smtp", minSeverity: "info", cfg: cfg})
+	}
+	return notifiers, nil
+}
+
+// dispatchEvent fans event out to every notifier whose MinSeverity it
+// clears, running them in parallel. A notifier that keeps failing after
+// retrying with backoff is logged as a dead letter rather than blocking
+// the other sinks.
+func dispatchEvent(ctx context.Context, notifiers []Notifier, event PasteEvent) {
+	var wg sync.WaitGroup
+	for _, n := range notifiers {
+		if !severityAtLeast(event.Severity, n.MinSeverity()) {
+			continue
+		}
+		wg.Add(1)
+		go func(n Notifier) {
+			defer wg.Done()
+			if err := notifyWithRetry(ctx, n, event, 3); err != nil {
+				log.Printf("DEADLETTER: notifier %s gave up on paste %s: %v", n.Name(), event.Paste.Key, err)
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+func notifyWithRetry(ctx context.Context, n Notifier, event PasteEvent, maxAttempts int) error {
+	backoff := 1 * time.Second
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = n.Notify(ctx, event); err == nil {
+			return nil
+		}
+		debugOutput("notifier %s attempt %d/%d failed: %v", n.Name(), attempt, maxAttempts, err)
+		if attempt == maxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+// smtpNotifier is the original email delivery path, wrapped so it fits
+// alongside the other sinks.
+type smtpNotifier struct {
+	name        string
+	minSeverity string
+	cfg         configuration
+}
+
+func (n *smtpNotifier) Name() string        { return n.name }
+func (n *smtpNotifier) MinSeverity() string { return n.minSeverity }
+
+func (n *smtpNotifier) Notify(ctx context.Context, event PasteEvent) error {
+	subject := fmt.Sprintf("Pastebin match: %s", event.Paste.Key)
+	body := fmt.Sprintf("Found a match in paste %s (severity: %s)\n\n%s\n\n%s",
+		event.Paste.FullURL, event.Severity, event.Excerpt, event.Paste.Body)
+	return sendMail(n.cfg, subject, body)
+}
+
+// webhookNotifier POSTs the raw PasteEvent as JSON to an arbitrary URL.
+type webhookNotifier struct {
+	name        string
+	minSeverity string
+	url         string
+}
+
+func (n *webhookNotifier) Name() string        { return n.name }
+func (n *webhookNotifier) MinSeverity() string { return n.minSeverity }
+
+func (n *webhookNotifier) Notify(ctx context.Context, event PasteEvent) error {
+	return postJSON(ctx, n.url, event)
+}
+
+// slackNotifier posts a short summary to a Slack incoming webhook.
+type slackNotifier struct {
+	name        string
+	minSeverity string
+	url         string
+}
+
+func (n *slackNotifier) Name() string        { return n.name }
+func (n *slackNotifier) MinSeverity() string { return n.minSeverity }
+
+func (n *slackNotifier) Notify(ctx context.Context, event PasteEvent) error {
+	payload := map[string]string{
+		"text": fmt.Sprintf("[%s] match in %s: %s", event.Severity, event.Paste.FullURL, event.Excerpt),
+	}
+	return postJSON(ctx, n.url, payload)
+}
+
+// matrixNotifier posts a short summary into a Matrix room via the
+// client-server API.
+type matrixNotifier struct {
+	name        string
+	minSeverity string
+	homeserver  string
+	room        string
+	token       string
+}
+
+func (n *matrixNotifier) Name() string        { return n.name }
+func (n *matrixNotifier) MinSeverity() string { return n.minSeverity }
+
+func (n *matrixNotifier) Notify(ctx context.Context, event PasteEvent) error {
+	reqURL := fmt.Sprintf("%s/_matrix/client/r0/rooms/%s/send/m.room.message?access_token=%s",
+		n.homeserver, url.PathEscape(n.room), url.QueryEscape(n.token))
+	payload := map[string]string{
+		"msgtype": "m.text",
+		"body":    fmt.Sprintf("[%s] match in %s: %s", event.Severity, event.Paste.FullURL, event.Excerpt),
+	}
+	return postJSON(ctx, reqURL, payload)
+}
+
+// splunkNotifier forwards the event to a Splunk HTTP Event Collector.
+type splunkNotifier struct {
+	name        string
+	minSeverity string
+	url         string
+	token       string
+	index       string
+	source      string
+}
+
+func (n *splunkNotifier) Name() string        { return n.name }
+func (n *splunkNotifier) MinSeverity() string { return n.minSeverity }
+
+func (n *splunkNotifier) Notify(ctx context.Context, event PasteEvent) error {
+	payload := map[string]interface{}{
+		"index":  n.index,
+		"source": n.source,
+		"event":  event,
+	}
+	return postJSONWithHeaders(ctx, n.url, payload, map[string]string{"Authorization": "Splunk " + n.token})
+}
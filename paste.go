@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+type paste struct {
+	Key     string
+	Date    string
+	Title   string
+	Size    string
+	Expire  string
+	FullURL string
+	Body    string
+	Matches map[string]keywordMatch
+}
+
+func (p paste) String() string {
+	return fmt.Sprintf("%s (%s)", p.Key, p.FullURL)
+}
+
+func fetchPasteList(ctx context.Context) ([]paste, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://scrape.pastebin.com/api_scraping.php?limit=100", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRateLimited(resp, body); err != nil {
+		return nil, err
+	}
+
+	var raw []struct {
+		Key    string `json:"key"`
+		Date   string `json:"date"`
+		Title  string `json:"title"`
+		Size   string `json:"size"`
+		Expire string `json:"expire"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("could not decode paste list: %v", err)
+	}
+
+	pastes := make([]paste, 0, len(raw))
+	for _, r := range raw {
+		pastes = append(pastes, paste{
+			Key:     r.Key,
+			Date:    r.Date,
+			Title:   r.Title,
+			Size:    r.Size,
+			Expire:  r.Expire,
+			FullURL: fmt.Sprintf("https://pastebin.com/%s", r.Key),
+		})
+	}
+	return pastes, nil
+}
+
+func (p paste) fetch(ctx context.Context, keywords *map[string]keywordType) (*paste, error) {
+	body, err := fetchText(ctx, fmt.Sprintf("https://scrape.pastebin.com/api_scrape_item.php?i=%s", p.Key))
+	if err != nil {
+		return nil, err
+	}
+	p.Body = body
+
+	result := checkKeywords(p.Body, keywords)
+	if !result.Matched {
+		return nil, nil
+	}
+	p.Matches = result.Keywords
+	debugOutput("matched keywords: %v", result.Keywords)
+	return &p, nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// PasteSource is implemented by anything that can list and fetch pastes
+// from a particular provider. The main loop treats every source the same
+// way regardless of whether it's the Pastebin scraping API, a Gist/GitLab
+// snippet feed, slexy.org, ix.io, a local file, or a plain HTTP(S) URL
+// list, so keyword matching and notification logic stays source-agnostic.
+type PasteSource interface {
+	// Name identifies the source in logs and error messages.
+	Name() string
+	// PollInterval controls how often List is called for this source.
+	PollInterval() time.Duration
+	// Limiter caps how fast this source is fetched from, independent of
+	// every other configured source.
+	Limiter() *rate.Limiter
+	// List returns the currently visible items for this source. Fetching
+	// the full body is deferred to Fetch so sources with a lightweight
+	// listing endpoint don't pay for bodies that turn out already seen.
+	List(ctx context.Context) ([]paste, error)
+	// Fetch retrieves the full body of a previously listed item and
+	// checks it against keywords, returning nil if nothing matched.
+	Fetch(ctx context.Context, p paste, keywords *map[string]keywordType) (*paste, error)
+}
+
+// SourceConfig describes one configured PasteSource in the config file.
+type SourceConfig struct {
+	Type         string `json:"type"`
+	Name         string `json:"name"`
+	URL          string `json:"url"`
+	Path         string `json:"path"`
+	PollInterval string `json:"poll_interval"`
+	RateLimit    string `json:"rate_limit"`
+}
+
+// sourceBase holds the fields and methods every PasteSource implementation
+// shares, so concrete sources only need to implement List and Fetch.
+type sourceBase struct {
+	name     string
+	interval time.Duration
+	limiter  *rate.Limiter
+}
+
+func (b *sourceBase) Name() string                { return b.name }
+func (b *sourceBase) PollInterval() time.Duration { return b.interval }
+func (b *sourceBase) Limiter() *rate.Limiter      { return b.limiter }
+
+// buildSources turns the configured source list into live PasteSources.
+func buildSources(cfgs []SourceConfig) ([]PasteSource, error) {
+	sources := make([]PasteSource, 0, len(cfgs))
+	for _, c := range cfgs {
+		interval := 1 * time.Minute
+		if c.PollInterval != "" {
+			var err error
+			interval, err = time.ParseDuration(c.PollInterval)
+			if err != nil {
+				return nil, fmt.Errorf("source %s: invalid poll_interval %q: %v", c.Name, c.PollInterval, err)
+			}
+		}
+
+		rps := 1.0
+		if c.RateLimit != "" {
+			var err error
+			rps, err = strconv.ParseFloat(c.RateLimit, 64)
+			if err != nil {
+				return nil, fmt.Errorf("source %s: invalid rate_limit %q: %v", c.Name, c.RateLimit, err)
+			}
+		}
+		base := sourceBase{interval: interval, limiter: rate.NewLimiter(rate.Limit(rps), 1)}
+
+		switch c.Type {
+		case "pastebin", "":
+			base.name = nameOr(c.Name, "pastebin")
+			sources = append(sources, &pastebinSource{sourceBase: base})
+		case "gist":
+			base.name = nameOr(c.Name, "gist")
+			sources = append(sources, newGenericScrapeSource(base,
+				orDefault(c.URL, "https://gist.github.com/discover"),
+				`href="/[^/"]+/([0-9a-f]{20,32})"`,
+				"https://gist.githubusercontent.com/raw/%s"))
+		case "gitlab":
+			base.name = nameOr(c.Name, "gitlab")
+			sources = append(sources, newGenericScrapeSource(base,
+				orDefault(c.URL, "https://gitlab.com/explore/snippets"),
+				`/-/snippets/(\d+)"`,
+				"https://gitlab.com/-/snippets/%s/raw"))
+		case "slexy":
+			base.name = nameOr(c.Name, "slexy")
+			sources = append(sources, newGenericScrapeSource(base,
+				orDefault(c.URL, "https://slexy.org/recent"),
+				`/view/([a-zA-Z0-9]+)"`,
+				"https://slexy.org/raw/%s"))
+		case "ixio":
+			base.name = nameOr(c.Name, "ix.io")
+			sources = append(sources, newGenericScrapeSource(base,
+				orDefault(c.URL, "http://ix.io/recent"),
+				`ix\.io/([a-zA-Z0-9]+)`,
+				"http://ix.io/%s"))
+		case "file":
+			if c.Path == "" {
+				return nil, fmt.Errorf("source %s: file sources require a path", c.Name)
+			}
+			base.name = nameOr(c.Name, c.Path)
+			sources = append(sources, &fileSource{sourceBase: base, path: c.Path})
+		case "http":
+			if c.URL == "" {
+				return nil, fmt.Errorf("source %s: http sources require a url", c.Name)
+			}
+			base.name = nameOr(c.Name, c.URL)
+			sources = append(sources, &httpListSource{sourceBase: base, listURL: c.URL})
+		default:
+			return nil, fmt.Errorf("source %s: unknown type %q", c.Name, c.Type)
+		}
+	}
+	return sources, nil
+}
+
+func nameOr(name, fallback string) string {
+	if name != "" {
+		return name
+	}
+	return fallback
+}
+
+func orDefault(s, fallback string) string {
+	if s != "" {
+		return s
+	}
+	return fallback
+}
+
+// pastebinSource is the original Pastebin scraping API, wrapped so it
+// fits alongside the other providers.
+type pastebinSource struct {
+	sourceBase
+}
+
+func (s *pastebinSource) List(ctx context.Context) ([]paste, error) {
+	return fetchPasteList(ctx)
+}
+
+func (s *pastebinSource) Fetch(ctx context.Context, p paste, keywords *map[string]keywordType) (*paste, error) {
+	return p.fetch(ctx, keywords)
+}
+
+// genericScrapeSource implements PasteSource for any provider that exposes
+// a listing page and individual raw-text URLs reachable by substituting a
+// scraped ID into a template. GitHub Gists, GitLab snippets, slexy.org and
+// ix.io all fit this shape.
+type genericScrapeSource struct {
+	sourceBase
+	listURL    string
+	listRegexp *regexp.Regexp
+	rawURLTmpl string
+}
+
+func newGenericScrapeSource(base sourceBase, listURL, listPattern, rawURLTmpl string) *genericScrapeSource {
+	return &genericScrapeSource{
+		sourceBase: base,
+		listURL:    listURL,
+		listRegexp: regexp.MustCompile(listPattern),
+		rawURLTmpl: rawURLTmpl,
+	}
+}
+
+func (s *genericScrapeSource) List(ctx context.Context) ([]paste, error) {
+	body, err := fetchText(ctx, s.listURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.name, err)
+	}
+
+	seen := make(map[string]bool)
+	var pastes []paste
+	for _, m := range s.listRegexp.FindAllStringSubmatch(body, -1) {
+		if len(m) < 2 || seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		pastes = append(pastes, paste{Key: m[1]})
+	}
+	return pastes, nil
+}
+
+func (s *genericScrapeSource) Fetch(ctx context.Context, p paste, keywords *map[string]keywordType) (*paste, error) {
+	url := fmt.Sprintf(s.rawURLTmpl, p.Key)
+	body, err := fetchText(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.name, err)
+	}
+	p.Body = body
+	p.FullURL = url
+
+	result := checkKeywords(p.Body, keywords)
+	if !result.Matched {
+		return nil, nil
+	}
+	p.Matches = result.Keywords
+	debugOutput("matched keywords in %s/%s: %v", s.name, p.Key, result.Keywords)
+	return &p, nil
+}
+
+// fileSource watches a single local file. Useful for feeding in pastes
+// collected by some other means. Each item is keyed by a hash of the
+// file's current contents rather than just its path, so the SeenStore
+// dedups on content: an edit between polls is picked up on the very next
+// poll, while an unchanged file is skipped until it's evicted.
+type fileSource struct {
+	sourceBase
+	path string
+}
+
+func (s *fileSource) List(ctx context.Context) ([]paste, error) {
+	body, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.name, err)
+	}
+	sum := sha256.Sum256(body)
+	key := fmt.Sprintf("%s#%x", s.path, sum[:8])
+	return []paste{{Key: key, FullURL: s.path}}, nil
+}
+
+func (s *fileSource) Fetch(ctx context.Context, p paste, keywords *map[string]keywordType) (*paste, error) {
+	body, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.name, err)
+	}
+	p.Body = string(body)
+
+	result := checkKeywords(p.Body, keywords)
+	if !result.Matched {
+		return nil, nil
+	}
+	p.Matches = result.Keywords
+	debugOutput("matched keywords in %s: %v", s.name, result.Keywords)
+	return &p, nil
+}
+
+// httpListSource treats the body at listURL as a newline-separated list of
+// URLs, each one fetched and checked independently.
+type httpListSource struct {
+	sourceBase
+	listURL string
+}
+
+func (s *httpListSource) List(ctx context.Context) ([]paste, error) {
+	body, err := fetchText(ctx, s.listURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.name, err)
+	}
+
+	var pastes []paste
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		url := strings.TrimSpace(scanner.Text())
+		if url == "" {
+			continue
+		}
+		pastes = append(pastes, paste{Key: url, FullURL: url})
+	}
+	return pastes, scanner.Err()
+}
+
+func (s *httpListSource) Fetch(ctx context.Context, p paste, keywords *map[string]keywordType) (*paste, error) {
+	body, err := fetchText(ctx, p.Key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.name, err)
+	}
+	p.Body = body
+
+	result := checkKeywords(p.Body, keywords)
+	if !result.Matched {
+		return nil, nil
+	}
+	p.Matches = result.Keywords
+	debugOutput("matched keywords in %s: %v", s.name, result.Keywords)
+	return &p, nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.etcd.io/bbolt"
+)
+
+var seenBucket = []byte("seen")
+
+// SeenStore tracks which paste keys have already been processed so
+// restarts don't re-alert on items seen minutes earlier, and so multiple
+// scraper instances can share a backend without double-alerting.
+type SeenStore interface {
+	// CheckAndSet atomically records key as seen and reports whether it
+	// was already present (and still within the retention window).
+	CheckAndSet(key string) (alreadySeen bool, err error)
+	// Stats returns hit/miss/size counters for metrics reporting.
+	Stats() SeenStoreStats
+	// Close releases any underlying resources.
+	Close() error
+}
+
+type SeenStoreStats struct {
+	Hits   int64
+	Misses int64
+	Size   int64
+}
+
+// StoreConfig configures which SeenStore backend to use.
+type StoreConfig struct {
+	Type      string `json:"type"`
+	Path      string `json:"path"`
+	Addr      string `json:"addr"`
+	Password  string `json:"password"`
+	DB        int    `json:"db"`
+	Retention string `json:"retention"`
+	Sweep     string `json:"sweep"`
+}
+
+// buildSeenStore constructs the configured SeenStore backend, defaulting
+// to a local BoltDB file so a restart doesn't re-alert on recently seen
+// pastes.
+func buildSeenStore(c StoreConfig) (SeenStore, error) {
+	retention := 10 * time.Minute
+	if c.Retention != "" {
+		var err error
+		retention, err = time.ParseDuration(c.Retention)
+		if err != nil {
+			return nil, fmt.Errorf("invalid store retention %q: %v", c.Retention, err)
+		}
+	}
+	sweep := 1 * time.Minute
+	if c.Sweep != "" {
+		var err error
+		sweep, err = time.ParseDuration(c.Sweep)
+		if err != nil {
+			return nil, fmt.Errorf("invalid store sweep %q: %v", c.Sweep, err)
+		}
+	}
+
+	switch c.Type {
+	case "redis":
+		if c.Addr == "" {
+			return nil, fmt.Errorf("redis store requires addr")
+		}
+		return newRedisSeenStore(c.Addr, c.Password, c.DB, retention)
+	case "bolt", "":
+		path := c.Path
+		if path == "" {
+			path = "seen.db"
+		}
+		return newBoltSeenStore(path, retention, sweep)
+	default:
+		return nil, fmt.Errorf("unknown store type %q", c.Type)
+	}
+}
+
+// boltSeenStore is the default SeenStore, backed by a local BoltDB file so
+// the dedup window survives process restarts.
+type boltSeenStore struct {
+	db        *bbolt.DB
+	retention time.Duration
+	hits      int64
+	misses    int64
+	stop      chan struct{}
+}
+
+func newBoltSeenStore(path string, retention, sweep time.Duration) (*boltSeenStore, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open bolt store %s: %v", path, err)
+	}
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(seenBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &boltSeenStore{db: db, retention: retention, stop: make(chan struct{})}
+	go s.evictLoop(sweep)
+	return s, nil
+}
+
+func (s *boltSeenStore) CheckAndSet(key string) (bool, error) {
+	now := time.Now()
+	var alreadySeen bool
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(seenBucket)
+		if existing := b.Get([]byte(key)); existing != nil {
+			seenAt := time.Unix(0, int64(binary.BigEndian.Uint64(existing)))
+			if now.Sub(seenAt) < s.retention {
+				alreadySeen = true
+				return nil
+			}
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(now.UnixNano()))
+		return b.Put([]byte(key), buf)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if alreadySeen {
+		atomic.AddInt64(&s.hits, 1)
+	} else {
+		atomic.AddInt64(&s.misses, 1)
+	}
+	return alreadySeen, nil
+}
+
+func (s *boltSeenStore) evictLoop(sweep time.Duration) {
+	ticker := time.NewTicker(sweep)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.evict()
+		}
+	}
+}
+
+func (s *boltSeenStore) evict() {
+	threshold := time.Now().Add(-s.retention)
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(seenBucket)
+		c := b.Cursor()
+
+		var expired [][]byte
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			seenAt := time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+			if seenAt.Before(threshold) {
+				expired = append(expired, append([]byte{}, k...))
+			}
+		}
+		for _, k := range expired {
+			debugOutput("deleting expired entry %s", k)
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("seen store eviction failed: %v", err)
+	}
+}
+
+func (s *boltSeenStore) Stats() SeenStoreStats {
+	var size int64
+	s.db.View(func(tx *bbolt.Tx) error {
+		size = int64(tx.Bucket(seenBucket).Stats().KeyN)
+		return nil
+	})
+	return SeenStoreStats{
+		Hits:   atomic.LoadInt64(&s.hits),
+		Misses: atomic.LoadInt64(&s.misses),
+		Size:   size,
+	}
+}
+
+func (s *boltSeenStore) Close() error {
+	close(s.stop)
+	return s.db.Close()
+}
+
+// redisSeenStore lets several scraper instances share one dedup backend.
+// TTL eviction is delegated to Redis itself via SETNX's expiry.
+type redisSeenStore struct {
+	client    *redis.Client
+	retention time.Duration
+	hits      int64
+	misses    int64
+}
+
+func newRedisSeenStore(addr, password string, db int, retention time.Duration) (*redisSeenStore, error) {
+	rdb := redis.NewClient(&redis.Options{Addr: addr, Password: password, DB: db})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("could not connect to redis at %s: %v", addr, err)
+	}
+	return &redisSeenStore{client: rdb, retention: retention}, nil
+}
+
+func (s *redisSeenStore) CheckAndSet(key string) (bool, error) {
+	set, err := s.client.SetNX(context.Background(), "seen:"+key, 1, s.retention).Result()
+	if err != nil {
+		return false, err
+	}
+	alreadySeen := !set
+	if alreadySeen {
+		atomic.AddInt64(&s.hits, 1)
+	} else {
+		atomic.AddInt64(&s.misses, 1)
+	}
+	return alreadySeen, nil
+}
+
+func (s *redisSeenStore) Stats() SeenStoreStats {
+	size, _ := s.client.DBSize(context.Background()).Result()
+	return SeenStoreStats{
+		Hits:   atomic.LoadInt64(&s.hits),
+		Misses: atomic.LoadInt64(&s.misses),
+		Size:   size,
+	}
+}
+
+func (s *redisSeenStore) Close() error {
+	return s.client.Close()
+}